@@ -0,0 +1,86 @@
+// Package discovery lets a node find out which miners are advertising a given
+// piece of data, without scraping the chain. It is populated locally as a side
+// effect of the deals a node's storage client makes.
+package discovery
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmRoARq3nkUb13HSKZGepCZSWe5GrVPwx7xURJGZ7KWv9V/go-ipld-cbor"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	"gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+// LocalDatastorePrefix namespaces the local discovery registry in a node's
+// repo datastore, alongside deal.ClientDatastorePrefix.
+const LocalDatastorePrefix = "/discovery/local"
+
+// RetrievalPeer identifies a peer advertising a given piece of data, and the
+// miner actor it is retrieving on behalf of.
+type RetrievalPeer struct {
+	Miner  address.Address
+	PeerID peer.ID
+}
+
+// Local is a persistent, on-disk registry mapping a payload CID to the set of
+// peers known to be able to serve it, most recently learned about from the
+// node's own storage deals.
+type Local struct {
+	ds repo.Datastore
+}
+
+func init() {
+	cbor.RegisterCborType(RetrievalPeer{})
+}
+
+// NewLocal returns a Local backed by ds.
+func NewLocal(ds repo.Datastore) *Local {
+	return &Local{ds: ds}
+}
+
+// AddPeer records that peer is able to serve payloadCid, deduplicating
+// against any peer already known for it.
+func (l *Local) AddPeer(payloadCid cid.Cid, p RetrievalPeer) error {
+	peers, err := l.GetPeers(payloadCid)
+	if err != nil {
+		return errors.Wrap(err, "failed to load existing retrieval peers")
+	}
+
+	for _, existing := range peers {
+		if existing.Miner == p.Miner && existing.PeerID == p.PeerID {
+			return nil
+		}
+	}
+	peers = append(peers, p)
+
+	datum, err := cbor.DumpObject(peers)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal retrieval peers")
+	}
+	return l.ds.Put(l.key(payloadCid), datum)
+}
+
+// GetPeers returns every peer known to be able to serve payloadCid. It
+// returns an empty slice, not an error, if none are known.
+func (l *Local) GetPeers(payloadCid cid.Cid) ([]RetrievalPeer, error) {
+	datum, err := l.ds.Get(l.key(payloadCid))
+	if err == datastore.ErrNotFound {
+		return []RetrievalPeer{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load retrieval peers")
+	}
+
+	var peers []RetrievalPeer
+	if err := cbor.DecodeInto(datum, &peers); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal retrieval peers")
+	}
+	return peers, nil
+}
+
+func (l *Local) key(payloadCid cid.Cid) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{LocalDatastorePrefix, payloadCid.String()})
+}
@@ -0,0 +1,73 @@
+package discovery
+
+import (
+	"testing"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	"gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+func TestLocalGetPeersUnknownPayload(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	l := NewLocal(datastore.NewMapDatastore())
+
+	peers, err := l.GetPeers(cid.Undef)
+	require.NoError(err)
+	assert.Empty(peers)
+}
+
+func TestLocalAddAndGetPeers(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	l := NewLocal(datastore.NewMapDatastore())
+	payloadCid := cid.Undef
+	p := RetrievalPeer{Miner: address.Address{}, PeerID: peer.ID("peer1")}
+
+	require.NoError(l.AddPeer(payloadCid, p))
+
+	peers, err := l.GetPeers(payloadCid)
+	require.NoError(err)
+	assert.Equal([]RetrievalPeer{p}, peers)
+}
+
+func TestLocalAddPeerDeduplicates(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	l := NewLocal(datastore.NewMapDatastore())
+	payloadCid := cid.Undef
+	p := RetrievalPeer{Miner: address.Address{}, PeerID: peer.ID("peer1")}
+
+	require.NoError(l.AddPeer(payloadCid, p))
+	require.NoError(l.AddPeer(payloadCid, p))
+
+	peers, err := l.GetPeers(payloadCid)
+	require.NoError(err)
+	assert.Len(peers, 1, "adding the same peer twice should not duplicate it")
+}
+
+func TestLocalAddPeerDistinguishesPeersForSamePayload(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	l := NewLocal(datastore.NewMapDatastore())
+	payloadCid := cid.Undef
+	first := RetrievalPeer{Miner: address.Address{}, PeerID: peer.ID("peer1")}
+	second := RetrievalPeer{Miner: address.Address{}, PeerID: peer.ID("peer2")}
+
+	require.NoError(l.AddPeer(payloadCid, first))
+	require.NoError(l.AddPeer(payloadCid, second))
+
+	peers, err := l.GetPeers(payloadCid)
+	require.NoError(err)
+	assert.ElementsMatch([]RetrievalPeer{first, second}, peers)
+}
@@ -2,7 +2,6 @@ package metrics
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -12,8 +11,12 @@ import (
 	"gx/ipfs/QmQsErDt8Qgw1XrsXf2BpEzDgGWtB1YLsTAARBup5b6B9W/go-libp2p-peer"
 	logging "gx/ipfs/QmRREK2CAZ5Re2Bd9zZFG6FeYDppUWt5cMgsoUEp3ktgSr/go-log"
 	ma "gx/ipfs/QmYmsdtJ3HsodkePE3eU3TsCaP2YvPZJ4LoXnNkDE5Tpt7/go-multiaddr"
+	cbor "gx/ipfs/QmRoARq3nkUb13HSKZGepCZSWe5GrVPwx7xURJGZ7KWv9V/go-ipld-cbor"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	pstore "gx/ipfs/QmeKD8YT7887Xu6Z86iZmpYNxrLogJexqxEugSmaf14k64/go-libp2p-peerstore"
 
+	"github.com/filecoin-project/go-filecoin/address"
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
 	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
 )
@@ -21,41 +24,88 @@ import (
 // HeartbeatProtocol is the libp2p protocol used for the heartbeat service
 const HeartbeatProtocol = "fil/heartbeat/1.0.0"
 
+// HeartbeatVersion is the current schema version of the Heartbeat message.
+// The aggregator rejects beats whose Version does not match.
+const HeartbeatVersion = 1
+
 var log = logging.Logger("metrics")
 
+func init() {
+	cbor.RegisterCborType(Heartbeat{})
+}
+
 // Heartbeat contains the information required to determine the current state of a node.
 // Heartbeats are used for aggregating information about nodes in a log aggregator
-// to support alerting and cluster visualization.
+// to support alerting and cluster visualization. Heartbeats are CBOR-framed on the
+// wire and signed by the node's default wallet address so an aggregator can attribute
+// (and trust) the beats it receives.
 type Heartbeat struct {
+	// Version is the schema version of this Heartbeat.
+	Version uint64
+	// Timestamp is the unix time, in seconds, at which this Heartbeat was created.
+	Timestamp int64
 	// Head represents the heaviest tipset the nodes is mining on
 	Head string
 	// Height represents the current height of the Tipset
 	Height uint64
 	// Nickname is the nickname given to the filecoin node by the user
 	Nickname string
+	// DealsInFlight is the number of storage deals the node's client is
+	// currently tracking that have not yet reached a terminal state.
+	DealsInFlight uint64
+	// NodeAddress is the address of the node's default wallet, used to verify Signature.
+	NodeAddress address.Address
+	// Signature is a signature, by NodeAddress, over the CBOR encoding of this Heartbeat
+	// with Signature itself zeroed.
+	Signature []byte
 	// TODO: add when implemented
 	// Syncing is `true` iff the node is currently syncing its chain with the network.
 	// Syncing bool
 }
 
+// signingBytes returns the deterministic CBOR payload that is signed and verified;
+// it is always computed with Signature zeroed so the signature does not sign itself.
+func (hb Heartbeat) signingBytes() ([]byte, error) {
+	hb.Signature = nil
+	return cbor.DumpObject(hb)
+}
+
+// heartbeatSigner signs heartbeat payloads with the node's wallet. It is satisfied
+// by the node's wallet.Wallet.
+type heartbeatSigner interface {
+	SignBytes(data []byte, addr address.Address) ([]byte, error)
+}
+
 // HeartbeatService is responsible for sending heartbeats.
 type HeartbeatService struct {
 	Host   host.Host
 	Config *config.HeartbeatConfig
 
+	// Address is the node's default wallet address; heartbeats are signed with it.
+	Address address.Address
+	// Signer signs heartbeat payloads on behalf of Address.
+	Signer heartbeatSigner
+
 	// A function that returns the heaviest tipset
 	HeadGetter func() consensus.TipSet
 
+	// A function that returns the number of storage deals the node's client
+	// currently has in flight. May be nil if the node has no storage client.
+	DealsInFlightGetter func() uint64
+
 	streamMu sync.Mutex
 	stream   net.Stream
 }
 
 // NewHeartbeatService returns a HeartbeatService
-func NewHeartbeatService(h host.Host, hbc *config.HeartbeatConfig, hg func() consensus.TipSet) *HeartbeatService {
+func NewHeartbeatService(h host.Host, hbc *config.HeartbeatConfig, hg func() consensus.TipSet, addr address.Address, signer heartbeatSigner, dealsInFlight func() uint64) *HeartbeatService {
 	return &HeartbeatService{
-		Host:       h,
-		Config:     hbc,
-		HeadGetter: hg,
+		Host:                h,
+		Config:              hbc,
+		HeadGetter:          hg,
+		Address:             addr,
+		Signer:              signer,
+		DealsInFlightGetter: dealsInFlight,
 	}
 }
 
@@ -127,14 +177,13 @@ func (hbs *HeartbeatService) Run(ctx context.Context) error {
 	beatTicker := time.NewTicker(bd)
 	defer beatTicker.Stop()
 
-	// TODO use cbor instead of json
-	encoder := json.NewEncoder(hbs.stream)
+	writer := cbu.NewMsgWriter(hbs.stream)
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		case <-beatTicker.C:
-			if err := hbs.Beat(encoder); err != nil {
+			if err := hbs.Beat(writer); err != nil {
 				hbs.stream.Conn().Close() // nolint: errcheck
 				return err
 			}
@@ -142,8 +191,8 @@ func (hbs *HeartbeatService) Run(ctx context.Context) error {
 	}
 }
 
-// Beat will create a heartbeat.
-func (hbs *HeartbeatService) Beat(enc *json.Encoder) error {
+// Beat will create, sign, and send a heartbeat.
+func (hbs *HeartbeatService) Beat(w *cbu.MsgWriter) error {
 	log.Debug("heartbeat service creating heartbeat")
 	nick := hbs.Config.Nickname
 	ts := hbs.HeadGetter()
@@ -152,11 +201,67 @@ func (hbs *HeartbeatService) Beat(enc *json.Encoder) error {
 	if err != nil {
 		log.Warningf("heartbeat service failed to get chain height: %s", err)
 	}
-	return enc.Encode(Heartbeat{
-		Head:     tipset,
-		Height:   height,
-		Nickname: nick,
-	})
+
+	var dealsInFlight uint64
+	if hbs.DealsInFlightGetter != nil {
+		dealsInFlight = hbs.DealsInFlightGetter()
+	}
+
+	hb := Heartbeat{
+		Version:       HeartbeatVersion,
+		Timestamp:     time.Now().Unix(),
+		Head:          tipset,
+		Height:        height,
+		Nickname:      nick,
+		DealsInFlight: dealsInFlight,
+		NodeAddress:   hbs.Address,
+	}
+
+	digest, err := hb.signingBytes()
+	if err != nil {
+		return errors.Wrap(err, "failed to build heartbeat signing payload")
+	}
+
+	sig, err := hbs.Signer.SignBytes(digest, hbs.Address)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign heartbeat")
+	}
+	hb.Signature = sig
+
+	return w.WriteMsg(hb)
+}
+
+// heartbeatVerifier verifies a signature produced by a node's wallet over a byte
+// payload. It is satisfied by the aggregator's wallet.Verifier.
+type heartbeatVerifier interface {
+	VerifyBytes(data []byte, sig []byte, addr address.Address) (bool, error)
+}
+
+// VerifyHeartbeat checks that hb is for the version of the protocol the aggregator
+// understands and that Signature is a valid signature by NodeAddress over the rest
+// of the Heartbeat. It returns an error describing why the beat is untrustworthy,
+// or nil if the beat is signed and versioned correctly.
+func VerifyHeartbeat(hb Heartbeat, verifier heartbeatVerifier) error {
+	if hb.Version != HeartbeatVersion {
+		return fmt.Errorf("unsupported heartbeat version: %d", hb.Version)
+	}
+	if len(hb.Signature) == 0 {
+		return fmt.Errorf("heartbeat from %s is unsigned", hb.NodeAddress)
+	}
+
+	digest, err := hb.signingBytes()
+	if err != nil {
+		return errors.Wrap(err, "failed to build heartbeat signing payload")
+	}
+
+	ok, err := verifier.VerifyBytes(digest, hb.Signature, hb.NodeAddress)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify heartbeat signature")
+	}
+	if !ok {
+		return fmt.Errorf("heartbeat from %s has an invalid signature", hb.NodeAddress)
+	}
+	return nil
 }
 
 // Connect will connects to `hbs.Config.BeatTarget` or returns an error
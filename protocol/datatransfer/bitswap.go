@@ -0,0 +1,73 @@
+package datatransfer
+
+import (
+	"context"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+)
+
+var errUnsupportedPush = errors.New("bitswap transport does not support push; open a pull channel from the receiving side instead")
+
+// BitswapTransport fetches a DAG block-by-block over bitswap, by walking its
+// links starting at the root CID. It is the fallback Transport: slower than a
+// selector-driven pull, but it works against any peer that merely has the
+// blocks in its blockstore, with no graphsync support required.
+type BitswapTransport struct {
+	dserv ipld.DAGService
+}
+
+// NewBitswapTransport returns a BitswapTransport that resolves DAGs through dserv.
+func NewBitswapTransport(dserv ipld.DAGService) *BitswapTransport {
+	return &BitswapTransport{dserv: dserv}
+}
+
+// Push is not supported over bitswap; a bitswap peer can only be pulled from.
+func (t *BitswapTransport) Push(ctx context.Context, p peer.ID, v Voucher) (<-chan Event, error) {
+	ch := make(chan Event, 1)
+	ch <- Event{Code: Error, Err: errUnsupportedPush}
+	close(ch)
+	return ch, nil
+}
+
+// Pull walks the DAG rooted at v.BaseCid, fetching each block bitswap hasn't
+// already got locally. peer is unused: bitswap resolves content by CID across
+// whichever peers have advertised it, rather than dialing p directly.
+func (t *BitswapTransport) Pull(ctx context.Context, p peer.ID, v Voucher) (<-chan Event, error) {
+	events := make(chan Event, 16)
+	go func() {
+		defer close(events)
+		events <- Event{Code: Open}
+
+		var sent uint64
+		err := traverseDAG(ctx, t.dserv, v.BaseCid, func(nd ipld.Node) {
+			sent += uint64(len(nd.RawData()))
+			events <- Event{Code: Progress, Sent: sent}
+		})
+		if err != nil {
+			events <- Event{Code: Error, Err: err}
+			return
+		}
+		events <- Event{Code: Complete, Sent: sent}
+	}()
+	return events, nil
+}
+
+// traverseDAG walks every node reachable from root, resolving each through
+// dserv (which will fetch it over bitswap if it is not already local), and
+// calls onBlock with each node visited.
+func traverseDAG(ctx context.Context, dserv ipld.DAGService, root cid.Cid, onBlock func(ipld.Node)) error {
+	nd, err := dserv.Get(ctx, root)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch block %s", root)
+	}
+	onBlock(nd)
+	for _, l := range nd.Links() {
+		if err := traverseDAG(ctx, dserv, l.Cid, onBlock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
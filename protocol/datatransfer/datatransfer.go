@@ -0,0 +1,163 @@
+// Package datatransfer moves the bytes backing a deal between a client and a
+// miner, independently of how the deal itself was negotiated. Negotiation
+// (protocol/storage) decides *what* is being sent; a Manager decides *how* the
+// bytes move, and can be swapped for a different Transport without either
+// side's deal logic changing.
+package datatransfer
+
+import (
+	"context"
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	logging "gx/ipfs/QmRREK2CAZ5Re2Bd9zZFG6FeYDppUWt5cMgsoUEp3ktgSr/go-log"
+)
+
+var log = logging.Logger("datatransfer")
+
+// EventCode identifies the kind of Event a channel emitted.
+type EventCode uint64
+
+const (
+	// Open is emitted when a channel is first opened, before any data moves.
+	Open EventCode = iota
+	// Progress is emitted as data moves; Event.Sent reports bytes moved so far.
+	Progress
+	// Complete is emitted once every byte described by the Voucher has moved.
+	Complete
+	// Error is emitted when a channel fails; Event.Err holds the cause.
+	Error
+)
+
+// ChannelID identifies a single push or pull transfer.
+type ChannelID uint64
+
+// Voucher authorizes a transfer of BaseCid's DAG and ties it to the deal
+// (identified by ProposalCid) that negotiated it. A transport must refuse to
+// move data for a channel whose Voucher it cannot validate.
+type Voucher struct {
+	ProposalCid cid.Cid
+	BaseCid     cid.Cid
+}
+
+// Event reports a change in a channel's progress.
+type Event struct {
+	Channel ChannelID
+	Code    EventCode
+	Sent    uint64
+	Err     error
+}
+
+// Transport moves the bytes described by a Voucher to or from a single peer.
+// Implementations are expected to emit Open, then zero or more Progress, then
+// exactly one of Complete or Error on the returned channel. The ChannelID on
+// each Event is assigned by the Manager, not the Transport; implementations
+// should leave it zero.
+type Transport interface {
+	// Push sends the DAG rooted at v.BaseCid to peer.
+	Push(ctx context.Context, peer peer.ID, v Voucher) (<-chan Event, error)
+	// Pull fetches the DAG rooted at v.BaseCid from peer.
+	Pull(ctx context.Context, peer peer.ID, v Voucher) (<-chan Event, error)
+}
+
+// Manager multiplexes channels across a Transport and re-publishes their
+// events to subscribers filtering by proposalCid.
+type Manager struct {
+	transport Transport
+
+	mu       sync.Mutex
+	nextID   ChannelID
+	vouchers map[ChannelID]Voucher
+
+	subsMu sync.Mutex
+	subs   map[cid.Cid][]chan Event
+}
+
+// NewManager returns a Manager backed by transport.
+func NewManager(transport Transport) *Manager {
+	return &Manager{
+		transport: transport,
+		vouchers:  make(map[ChannelID]Voucher),
+		subs:      make(map[cid.Cid][]chan Event),
+	}
+}
+
+// OpenPushChannel opens a channel that sends v's data to peer. Events for the
+// channel are also delivered to any subscriber registered for v.ProposalCid.
+func (m *Manager) OpenPushChannel(ctx context.Context, peer peer.ID, v Voucher) (ChannelID, error) {
+	return m.open(ctx, peer, v, m.transport.Push)
+}
+
+// OpenPullChannel opens a channel that fetches v's data from peer. Events for
+// the channel are also delivered to any subscriber registered for v.ProposalCid.
+func (m *Manager) OpenPullChannel(ctx context.Context, peer peer.ID, v Voucher) (ChannelID, error) {
+	return m.open(ctx, peer, v, m.transport.Pull)
+}
+
+type openFunc func(ctx context.Context, peer peer.ID, v Voucher) (<-chan Event, error)
+
+func (m *Manager) open(ctx context.Context, peer peer.ID, v Voucher, open openFunc) (ChannelID, error) {
+	events, err := open(ctx, peer, v)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open data transfer channel")
+	}
+
+	m.mu.Lock()
+	m.nextID++
+	id := m.nextID
+	m.vouchers[id] = v
+	m.mu.Unlock()
+
+	go m.relay(id, v.ProposalCid, events)
+	return id, nil
+}
+
+// relay forwards every event from a channel to subscribers of proposalCid,
+// stamping each with the Manager-assigned ChannelID.
+func (m *Manager) relay(id ChannelID, proposalCid cid.Cid, events <-chan Event) {
+	for ev := range events {
+		ev.Channel = id
+		m.subsMu.Lock()
+		for _, ch := range m.subs[proposalCid] {
+			select {
+			case ch <- ev:
+			default:
+				log.Warningf("dropping data transfer event for slow subscriber, proposalCid: %s", proposalCid)
+			}
+		}
+		m.subsMu.Unlock()
+	}
+}
+
+// Subscribe registers a channel that receives every Event for proposalCid.
+// Callers that intend to OpenPushChannel/OpenPullChannel for proposalCid must
+// Subscribe first, so that no early event is published before a subscriber is
+// listening for it.
+func (m *Manager) Subscribe(proposalCid cid.Cid) <-chan Event {
+	ch := make(chan Event, 16)
+	m.subsMu.Lock()
+	m.subs[proposalCid] = append(m.subs[proposalCid], ch)
+	m.subsMu.Unlock()
+	return ch
+}
+
+// Unsubscribe removes a channel registered by Subscribe and closes it. It is
+// a no-op if ch is not currently subscribed for proposalCid.
+func (m *Manager) Unsubscribe(proposalCid cid.Cid, ch <-chan Event) {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+
+	subs := m.subs[proposalCid]
+	for i, sub := range subs {
+		if sub == ch {
+			m.subs[proposalCid] = append(subs[:i], subs[i+1:]...)
+			close(sub)
+			break
+		}
+	}
+	if len(m.subs[proposalCid]) == 0 {
+		delete(m.subs, proposalCid)
+	}
+}
@@ -0,0 +1,70 @@
+package datatransfer
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransport immediately emits every event in events on the channel it
+// returns, before Push/Pull returns, so tests can exercise the
+// subscribe-then-open ordering the Manager relies on.
+type fakeTransport struct {
+	events []Event
+}
+
+func (t *fakeTransport) Push(ctx context.Context, p peer.ID, v Voucher) (<-chan Event, error) {
+	ch := make(chan Event, len(t.events))
+	for _, ev := range t.events {
+		ch <- ev
+	}
+	close(ch)
+	return ch, nil
+}
+
+func (t *fakeTransport) Pull(ctx context.Context, p peer.ID, v Voucher) (<-chan Event, error) {
+	return t.Push(ctx, p, v)
+}
+
+func TestManagerSubscribeBeforeOpenSeesAllEvents(t *testing.T) {
+	require := require.New(t)
+
+	proposalCid := cid.Undef
+	m := NewManager(&fakeTransport{events: []Event{
+		{Code: Open},
+		{Code: Progress, Sent: 10},
+		{Code: Complete},
+	}})
+
+	// Subscribing first, as ProposeDeal now does, must see every event even
+	// though the transport delivers them synchronously during open.
+	sub := m.Subscribe(proposalCid)
+
+	_, err := m.OpenPushChannel(context.Background(), peer.ID(""), Voucher{ProposalCid: proposalCid})
+	require.NoError(err)
+
+	var codes []EventCode
+	for i := 0; i < 3; i++ {
+		codes = append(codes, (<-sub).Code)
+	}
+	require.Equal([]EventCode{Open, Progress, Complete}, codes)
+}
+
+func TestManagerUnsubscribeClosesChannel(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewManager(&fakeTransport{})
+	proposalCid := cid.Undef
+	sub := m.Subscribe(proposalCid)
+
+	m.Unsubscribe(proposalCid, sub)
+
+	_, ok := <-sub
+	assert.False(ok, "channel should be closed after Unsubscribe")
+	assert.Empty(m.subs[proposalCid])
+}
@@ -0,0 +1,41 @@
+package datatransfer
+
+import (
+	"context"
+
+	"gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+// GraphsyncTransport pulls a DAG from a single peer using selector-driven
+// requests, the way graphsync does. It is the default Transport: a miner can
+// request exactly the blocks of a piece it is missing instead of walking the
+// DAG one block at a time.
+//
+// This is a minimal placeholder implementation; it satisfies Transport so
+// Manager has something to drive today, and is meant to be replaced by a real
+// graphsync-backed implementation without any change to its callers.
+type GraphsyncTransport struct {
+	requester graphsyncRequester
+}
+
+// graphsyncRequester issues a single selector request against a peer and
+// streams back the blocks it resolves to.
+type graphsyncRequester interface {
+	RequestDAG(ctx context.Context, peer peer.ID, v Voucher) (<-chan Event, error)
+}
+
+// NewGraphsyncTransport returns a GraphsyncTransport backed by requester.
+func NewGraphsyncTransport(requester graphsyncRequester) *GraphsyncTransport {
+	return &GraphsyncTransport{requester: requester}
+}
+
+// Push has no graphsync request of its own, since graphsync only pulls: it
+// issues the same request as Pull, fetching the DAG rooted at v.BaseCid from p.
+func (t *GraphsyncTransport) Push(ctx context.Context, p peer.ID, v Voucher) (<-chan Event, error) {
+	return t.Pull(ctx, p, v)
+}
+
+// Pull fetches the DAG rooted at v.BaseCid from p via a single selector request.
+func (t *GraphsyncTransport) Pull(ctx context.Context, p peer.ID, v Voucher) (<-chan Event, error) {
+	return t.requester.RequestDAG(ctx, p, v)
+}
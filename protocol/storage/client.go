@@ -14,13 +14,14 @@ import (
 	"gx/ipfs/QmabLh8TrJ3emfAoQk5AbqbLTbMyj7XqumMFmAFxa9epo8/go-multistream"
 	"gx/ipfs/QmaoXrM4Z41PD48JY36YqQGKQpLGjyLA2cKcLsES7YddAq/go-libp2p-host"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
-	"gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/discovery"
 	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/protocol/datatransfer"
 	"github.com/filecoin-project/go-filecoin/protocol/storage/deal"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -65,33 +66,82 @@ type clientPorcelainAPI interface {
 	MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
 	MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error)
 	DealsLs() (<-chan *deal.Deal, <-chan error)
+	WalletSign(addr address.Address, data []byte) ([]byte, error)
 }
 
-// Client is used to make deals directly with storage miners.
+// walletSigner adapts clientPorcelainAPI.WalletSign, bound to a single
+// address, to deal.Signer.
+type walletSigner struct {
+	api  clientPorcelainAPI
+	addr address.Address
+}
+
+func (w walletSigner) SignBytes(data []byte) ([]byte, error) {
+	return w.api.WalletSign(w.addr, data)
+}
+
+// Client is used to make deals directly with storage miners. Once created, a
+// Client runs a single deals-manager goroutine that owns every in-progress
+// deal; the rest of the methods on Client are safe to call concurrently and
+// communicate with that goroutine over smc.updates.
 type Client struct {
 	deals   map[cid.Cid]*deal.Deal
 	dealsDs repo.Datastore
 	dealsLk sync.Mutex
 
+	statestore *statestore
+	updates    chan clientDealUpdate
+	events     *eventBus
+
+	// pollingLk guards polling, the set of deals with a pollDeal goroutine
+	// currently running for them, so at most one poller per deal is ever live.
+	pollingLk sync.Mutex
+	polling   map[cid.Cid]struct{}
+
 	node clientNode
 	api  clientPorcelainAPI
+	dt   *datatransfer.Manager
+
+	// discoveryLocal records, for every deal this client has made, which
+	// miner/peer can be asked to retrieve the data back.
+	discoveryLocal *discovery.Local
+
+	// dealIndex lets deals be looked up by payload cid or by miner without a
+	// full scan of smc.deals.
+	dealIndex *dealIndex
 }
 
 func init() {
 	cbor.RegisterCborType(deal.Deal{})
 }
 
-// NewClient creates a new storage client.
-func NewClient(nd clientNode, api clientPorcelainAPI, dealsDs repo.Datastore) (*Client, error) {
+// NewClient creates a new storage client and starts its deals-manager
+// goroutine, rehydrating any deals left in-flight from a previous run and
+// resuming their miner polling. The manager runs until ctx is done.
+func NewClient(ctx context.Context, nd clientNode, api clientPorcelainAPI, dealsDs repo.Datastore, dt *datatransfer.Manager, discoveryLocal *discovery.Local) (*Client, error) {
 	smc := &Client{
-		deals:   make(map[cid.Cid]*deal.Deal),
-		node:    nd,
-		api:     api,
-		dealsDs: dealsDs,
-	}
+		deals:          make(map[cid.Cid]*deal.Deal),
+		node:           nd,
+		api:            api,
+		dealsDs:        dealsDs,
+		updates:        make(chan clientDealUpdate),
+		events:         newEventBus(),
+		polling:        make(map[cid.Cid]struct{}),
+		dt:             dt,
+		discoveryLocal: discoveryLocal,
+	}
+	smc.statestore = newStatestore(dealsDs)
+	smc.dealIndex = newDealIndex(dealsDs)
 	if err := smc.loadDeals(); err != nil {
 		return nil, errors.Wrap(err, "failed to load client deals")
 	}
+	if err := migrateDealIndex(dealsDs, smc.dealIndex, smc.deals); err != nil {
+		return nil, errors.Wrap(err, "failed to migrate client deal index")
+	}
+
+	go smc.run(ctx)
+	smc.resumeDeals(ctx)
+
 	return smc, nil
 }
 
@@ -135,7 +185,6 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		TotalPrice:   totalPrice,
 		Duration:     duration,
 		MinerAddress: miner,
-		// TODO: Sign this proposal
 	}
 
 	// check for duplicate deal prior to creating payment info
@@ -144,12 +193,12 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		return nil, errors.Wrap(err, "failed to get cid of proposal")
 	}
 
-	_, isDuplicate := smc.deals[proposalCid]
+	isDuplicate := smc.hasDeal(proposalCid)
 	if isDuplicate && !allowDuplicates {
 		return nil, Errors[ErrDuplicateDeal]
 	}
 
-	for ; isDuplicate; _, isDuplicate = smc.deals[proposalCid] {
+	for ; isDuplicate; isDuplicate = smc.hasDeal(proposalCid) {
 		proposal.LastDuplicate = proposalCid.String()
 
 		proposalCid, err = convert.ToCid(proposal)
@@ -177,6 +226,13 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	proposal.Payment.ChannelMsgCid = cpResp.ChannelMsgCid.String()
 	proposal.Payment.Vouchers = cpResp.Vouchers
 
+	proposal.ProposerAddress = fromAddress
+	sig, err := proposal.Sign(walletSigner{api: smc.api, addr: fromAddress})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign proposal")
+	}
+	proposal.ProposerSignature = sig
+
 	// send proposal
 	pid, err := smc.api.MinerGetPeerID(ctx, miner)
 	if err != nil {
@@ -193,29 +249,66 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		return nil, errors.Wrap(err, "response check failed")
 	}
 
-	// Note: currently the miner requests the data out of band
-
-	if err := smc.recordResponse(&response, miner, proposal, proposalCid); err != nil {
+	if err := smc.recordResponse(ctx, &response, miner, proposal, proposalCid); err != nil {
 		return nil, errors.Wrap(err, "failed to track response")
 	}
 
+	if err := smc.discoveryLocal.AddPeer(data, discovery.RetrievalPeer{Miner: miner, PeerID: pid}); err != nil {
+		log.Warningf("failed to record retrieval peer for %s: %s", data, err)
+	}
+
+	// Subscribe before opening the channel: Manager.relay delivers events as
+	// soon as the channel opens, and a subscriber registered only after the
+	// fact can miss an early Open/Progress/Complete and strand the deal.
+	transferEvents := smc.dt.Subscribe(proposalCid)
+	voucher := datatransfer.Voucher{ProposalCid: proposalCid, BaseCid: data}
+	if _, err := smc.dt.OpenPushChannel(ctx, pid, voucher); err != nil {
+		smc.dt.Unsubscribe(proposalCid, transferEvents)
+		return nil, errors.Wrap(err, "failed to open data transfer channel")
+	}
+	go smc.watchTransfer(ctx, proposalCid, transferEvents)
+
 	return &response, nil
 }
 
-func (smc *Client) recordResponse(resp *deal.Response, miner address.Address, p *deal.Proposal, proposalCid cid.Cid) error {
+// hasDeal reports whether proposalCid already has a recorded deal. Every
+// access to smc.deals must go through this or another method that takes
+// smc.dealsLk, since the deals manager goroutine mutates it concurrently.
+func (smc *Client) hasDeal(proposalCid cid.Cid) bool {
 	smc.dealsLk.Lock()
 	defer smc.dealsLk.Unlock()
 	_, ok := smc.deals[proposalCid]
+	return ok
+}
+
+func (smc *Client) recordResponse(ctx context.Context, resp *deal.Response, miner address.Address, p *deal.Proposal, proposalCid cid.Cid) error {
+	smc.dealsLk.Lock()
+	_, ok := smc.deals[proposalCid]
 	if ok {
+		smc.dealsLk.Unlock()
 		return fmt.Errorf("deal [%s] is already in progress", proposalCid.String())
 	}
 
-	smc.deals[proposalCid] = &deal.Deal{
+	d := &deal.Deal{
 		Miner:    miner,
 		Proposal: p,
 		Response: resp,
 	}
-	return smc.saveDeal(proposalCid)
+	smc.deals[proposalCid] = d
+	err := smc.statestore.Put(proposalCid, d)
+	smc.dealsLk.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := smc.dealIndex.Add(p.PieceRef, miner, proposalCid); err != nil {
+		return errors.Wrap(err, "failed to index deal")
+	}
+
+	// Hand the deal off to the deals manager so it starts polling the miner
+	// for progress past its initial Accepted state.
+	smc.sendUpdate(ctx, clientDealUpdate{proposalCid: proposalCid, state: resp.State, message: resp.Message})
+	return nil
 }
 
 func (smc *Client) checkDealResponse(ctx context.Context, resp *deal.Response) error {
@@ -242,6 +335,12 @@ func (smc *Client) minerForProposal(c cid.Cid) (address.Address, error) {
 	return st.Miner, nil
 }
 
+// FindData returns every peer this client knows, from its own past deals,
+// to be able to serve payloadCid.
+func (smc *Client) FindData(payloadCid cid.Cid) ([]discovery.RetrievalPeer, error) {
+	return smc.discoveryLocal.GetPeers(payloadCid)
+}
+
 // QueryDeal queries an in-progress proposal.
 func (smc *Client) QueryDeal(ctx context.Context, proposalCid cid.Cid) (*deal.Response, error) {
 	mineraddr, err := smc.minerForProposal(proposalCid)
@@ -268,31 +367,21 @@ func (smc *Client) loadDeals() error {
 	smc.deals = make(map[cid.Cid]*deal.Deal)
 
 	deals, doneOrError := smc.api.DealsLs()
-	select {
-	case storageDeal := <-deals:
-		smc.deals[storageDeal.Response.ProposalCid] = storageDeal
-	case errOrNil := <-doneOrError:
-		return errOrNil
-	}
-	return nil
-}
-
-func (smc *Client) saveDeal(cid cid.Cid) error {
-	storageDeal, ok := smc.deals[cid]
-	if !ok {
-		return errors.Errorf("Could not find client deal with cid: %s", cid.String())
-	}
-	datum, err := cbor.DumpObject(storageDeal)
-	if err != nil {
-		return errors.Wrap(err, "could not marshal storageDeal")
-	}
-
-	key := datastore.KeyWithNamespaces([]string{deal.ClientDatastorePrefix, cid.String()})
-	err = smc.dealsDs.Put(key, datum)
-	if err != nil {
-		return errors.Wrap(err, "could not save client deal to disk, in-memory deals differ from persisted deals!")
+	for {
+		select {
+		case storageDeal, ok := <-deals:
+			if !ok {
+				deals = nil
+				continue
+			}
+			smc.deals[storageDeal.Response.ProposalCid] = storageDeal
+		case err, ok := <-doneOrError:
+			if !ok {
+				return nil
+			}
+			return err
+		}
 	}
-	return nil
 }
 
 // LoadVouchersForDeal loads vouchers from disk for a given deal
@@ -300,15 +389,23 @@ func (smc *Client) LoadVouchersForDeal(dealCid cid.Cid) ([]*paymentbroker.Paymen
 	var results []*paymentbroker.PaymentVoucher
 
 	deals, doneOrError := smc.api.DealsLs()
-	select {
-	case storageDeal := <-deals:
-		if storageDeal.Response.ProposalCid == dealCid {
-			results = append(results, storageDeal.Proposal.Payment.Vouchers...)
+	for {
+		select {
+		case storageDeal, ok := <-deals:
+			if !ok {
+				deals = nil
+				continue
+			}
+			if storageDeal.Response.ProposalCid == dealCid {
+				results = append(results, storageDeal.Proposal.Payment.Vouchers...)
+			}
+		case err, ok := <-doneOrError:
+			if !ok {
+				return results, nil
+			}
+			return results, err
 		}
-	case errOrNil := <-doneOrError:
-		return results, errOrNil
 	}
-	return results, nil
 }
 
 // ClientNodeImpl implements the client node interface
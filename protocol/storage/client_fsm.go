@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmRoARq3nkUb13HSKZGepCZSWe5GrVPwx7xURJGZ7KWv9V/go-ipld-cbor"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	logging "gx/ipfs/QmRREK2CAZ5Re2Bd9zZFG6FeYDppUWt5cMgsoUEp3ktgSr/go-log"
+	"gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/protocol/datatransfer"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/deal"
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+var log = logging.Logger("storage")
+
+// dealPollInterval is how often the deals manager polls a miner for the status
+// of a deal that has not yet reached a terminal state.
+const dealPollInterval = 1 * time.Minute
+
+// clientDealUpdate is delivered to the deals manager run loop whenever a deal
+// should transition to a new state.
+type clientDealUpdate struct {
+	proposalCid cid.Cid
+	state       deal.State
+	message     string
+}
+
+// sendUpdate delivers upd to the deals manager over smc.updates, an
+// unbuffered channel. It does not block forever if ctx is done first --
+// the deals manager's run loop stops reading as soon as ctx is canceled, and
+// a sender that ignored ctx would hang until the process exits.
+func (smc *Client) sendUpdate(ctx context.Context, upd clientDealUpdate) {
+	select {
+	case smc.updates <- upd:
+	case <-ctx.Done():
+	}
+}
+
+// eventTypeForState maps a deal's new State to the Event it produces on the
+// Client's event bus.
+func eventTypeForState(s deal.State) EventType {
+	switch s {
+	case deal.Accepted:
+		return DealAccepted
+	case deal.Rejected:
+		return DealRejected
+	case deal.Failed:
+		return DealFailed
+	case deal.Staged:
+		return DealStaged
+	case deal.Sealing:
+		return DealSealing
+	case deal.Active:
+		return DealActive
+	case deal.Complete:
+		return DealCompleted
+	default:
+		return DealProposed
+	}
+}
+
+// statestore persists client deal records and their state transitions. It is a
+// thin, deal-aware wrapper around the Client's deals datastore so that state
+// changes are durable and survive a node restart.
+type statestore struct {
+	ds repo.Datastore
+}
+
+func newStatestore(ds repo.Datastore) *statestore {
+	return &statestore{ds: ds}
+}
+
+func (s *statestore) Put(proposalCid cid.Cid, d *deal.Deal) error {
+	datum, err := cbor.DumpObject(d)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal client deal")
+	}
+	key := datastore.KeyWithNamespaces([]string{deal.ClientDatastorePrefix, proposalCid.String()})
+	if err := s.ds.Put(key, datum); err != nil {
+		return errors.Wrap(err, "could not persist client deal state transition")
+	}
+	return nil
+}
+
+// run is the Client's single deals-manager goroutine. It applies every state
+// transition to the deals in smc.deals (new deals are added by recordResponse),
+// and it is responsible for persisting every state transition before
+// broadcasting it to subscribers.
+func (smc *Client) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case upd := <-smc.updates:
+			smc.applyUpdate(ctx, upd)
+		}
+	}
+}
+
+func (smc *Client) applyUpdate(ctx context.Context, upd clientDealUpdate) {
+	smc.dealsLk.Lock()
+	d, ok := smc.deals[upd.proposalCid]
+	if !ok {
+		smc.dealsLk.Unlock()
+		log.Errorf("received update for unknown deal: %s", upd.proposalCid)
+		return
+	}
+	d.Response.State = upd.state
+	d.Response.Message = upd.message
+	miner := d.Miner
+	err := smc.statestore.Put(upd.proposalCid, d)
+	smc.dealsLk.Unlock()
+	if err != nil {
+		log.Errorf("failed to persist deal state transition: %s", err)
+	}
+
+	smc.events.Publish(Event{
+		Type:        eventTypeForState(upd.state),
+		ProposalCid: upd.proposalCid,
+		Miner:       miner,
+		Timestamp:   time.Now().Unix(),
+		Payload:     upd.message,
+	})
+
+	switch upd.state {
+	case deal.Accepted, deal.Staged, deal.Sealing:
+		// Not yet terminal: keep polling the miner for progress. startPolling
+		// is a no-op if a poller for this deal is already running, so the
+		// updates that poller itself feeds back through smc.updates don't
+		// spawn duplicate pollers.
+		smc.startPolling(ctx, upd.proposalCid)
+	}
+}
+
+// startPolling starts a pollDeal goroutine for proposalCid unless one is
+// already running.
+func (smc *Client) startPolling(ctx context.Context, proposalCid cid.Cid) {
+	smc.pollingLk.Lock()
+	if _, ok := smc.polling[proposalCid]; ok {
+		smc.pollingLk.Unlock()
+		return
+	}
+	smc.polling[proposalCid] = struct{}{}
+	smc.pollingLk.Unlock()
+
+	go smc.pollDeal(ctx, proposalCid)
+}
+
+// pollDeal periodically queries the miner for the status of proposalCid until
+// the deal reaches a terminal state (Complete, Rejected, or Failed) or
+// ctx is done. Only one pollDeal goroutine runs per deal at a time; see
+// startPolling.
+func (smc *Client) pollDeal(ctx context.Context, proposalCid cid.Cid) {
+	defer smc.stopPolling(proposalCid)
+
+	ticker := time.NewTicker(dealPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resp, err := smc.QueryDeal(ctx, proposalCid)
+			if err != nil {
+				log.Warningf("failed to query deal %s: %s", proposalCid, err)
+				continue
+			}
+			smc.sendUpdate(ctx, clientDealUpdate{proposalCid: proposalCid, state: resp.State, message: resp.Message})
+			if isTerminal(resp.State) {
+				return
+			}
+		}
+	}
+}
+
+func isTerminal(s deal.State) bool {
+	return s == deal.Complete || s == deal.Rejected || s == deal.Failed
+}
+
+// stopPolling marks proposalCid as no longer having a live poller, allowing a
+// future update to start a new one.
+func (smc *Client) stopPolling(proposalCid cid.Cid) {
+	smc.pollingLk.Lock()
+	delete(smc.polling, proposalCid)
+	smc.pollingLk.Unlock()
+}
+
+// watchTransfer consumes the data transfer events for proposalCid (from a
+// channel the caller Subscribed to before opening the transfer, so no early
+// event is missed) and feeds their outcome into the deals manager: a
+// completed transfer advances the deal to Staged (the miner now has the
+// piece and can start sealing it), and a failed transfer fails the deal.
+func (smc *Client) watchTransfer(ctx context.Context, proposalCid cid.Cid, events <-chan datatransfer.Event) {
+	defer smc.dt.Unsubscribe(proposalCid, events)
+	for ev := range events {
+		switch ev.Code {
+		case datatransfer.Complete:
+			smc.sendUpdate(ctx, clientDealUpdate{proposalCid: proposalCid, state: deal.Staged, message: "data transfer complete"})
+			return
+		case datatransfer.Error:
+			smc.sendUpdate(ctx, clientDealUpdate{proposalCid: proposalCid, state: deal.Failed, message: ev.Err.Error()})
+			return
+		}
+	}
+}
+
+// resumeDeals is called once at startup, after loadDeals has populated
+// smc.deals from disk, to resume polling every deal that has not yet reached a
+// terminal state.
+func (smc *Client) resumeDeals(ctx context.Context) {
+	smc.dealsLk.Lock()
+	pending := make([]cid.Cid, 0)
+	for proposalCid, d := range smc.deals {
+		if !isTerminal(d.Response.State) {
+			pending = append(pending, proposalCid)
+		}
+	}
+	smc.dealsLk.Unlock()
+
+	for _, proposalCid := range pending {
+		smc.startPolling(ctx, proposalCid)
+	}
+}
+
+// DealsInFlight returns the number of deals this client is tracking that have
+// not yet reached a terminal state. It backs the node's heartbeat.
+func (smc *Client) DealsInFlight() uint64 {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	var n uint64
+	for _, d := range smc.deals {
+		if !isTerminal(d.Response.State) {
+			n++
+		}
+	}
+	return n
+}
+
+// GetDealInfo returns the client's current view of the deal identified by
+// proposalCid.
+func (smc *Client) GetDealInfo(ctx context.Context, proposalCid cid.Cid) (*deal.Deal, error) {
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	d, ok := smc.deals[proposalCid]
+	if !ok {
+		return nil, errors.Errorf("no such deal: %s", proposalCid)
+	}
+	return d, nil
+}
+
+// Subscribe registers a channel that receives every Event matching filter
+// that the deals manager produces from here forward. A nil filter matches
+// every Event. The returned CancelFunc must be called to unregister the
+// channel and release its resources.
+func (smc *Client) Subscribe(filter Filter) (<-chan Event, CancelFunc) {
+	return smc.events.Subscribe(filter)
+}
+
+// RecentEvents returns up to eventRingSize of the most recently published
+// deal events, oldest first, regardless of whether anything was subscribed
+// at the time they occurred.
+func (smc *Client) RecentEvents() []Event {
+	return smc.events.Recent()
+}
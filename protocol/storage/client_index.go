@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmRoARq3nkUb13HSKZGepCZSWe5GrVPwx7xURJGZ7KWv9V/go-ipld-cbor"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/deal"
+	"github.com/filecoin-project/go-filecoin/repo"
+)
+
+const (
+	// payloadIndexPrefix namespaces the payloadCid -> proposalCid index.
+	payloadIndexPrefix = "/storage/client/index/payload"
+	// minerIndexPrefix namespaces the miner -> []proposalCid index.
+	minerIndexPrefix = "/storage/client/index/miner"
+	// indexMigratedKey marks that the secondary indexes have been built at
+	// least once, so a node does not rebuild them from scratch on every boot.
+	indexMigratedKey = "/storage/client/index/migrated"
+)
+
+// dealIndex maintains two secondary indexes over a client's deals, so that
+// looking a deal up by the data it moves or the miner it is with doesn't
+// require a full scan of every deal on disk.
+type dealIndex struct {
+	ds repo.Datastore
+
+	// mu serializes Add's read-modify-write of minerIndexKey: two concurrent
+	// deals with the same miner must not race on reading, appending to, and
+	// writing back the same []cid.Cid.
+	mu sync.Mutex
+}
+
+func newDealIndex(ds repo.Datastore) *dealIndex {
+	return &dealIndex{ds: ds}
+}
+
+// Add records that proposalCid is indexed under payloadCid and miner. It is
+// safe, and cheap, to call repeatedly for the same deal, and safe to call
+// concurrently for different deals.
+func (idx *dealIndex) Add(payloadCid cid.Cid, miner address.Address, proposalCid cid.Cid) error {
+	if err := idx.ds.Put(payloadIndexKey(payloadCid), []byte(proposalCid.String())); err != nil {
+		return errors.Wrap(err, "failed to index deal by payload cid")
+	}
+
+	// The miner index is a read-modify-write: two concurrent Adds for the
+	// same miner must not interleave their read of the existing []cid.Cid
+	// with their write of the appended one.
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	existing, err := idx.ByMiner(miner)
+	if err != nil {
+		return err
+	}
+	for _, c := range existing {
+		if c == proposalCid {
+			return nil
+		}
+	}
+	existing = append(existing, proposalCid)
+
+	datum, err := cbor.DumpObject(existing)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal miner deal index")
+	}
+	if err := idx.ds.Put(minerIndexKey(miner), datum); err != nil {
+		return errors.Wrap(err, "failed to index deal by miner")
+	}
+	return nil
+}
+
+// ByPayload returns the proposalCid of the deal that moved payloadCid, if any.
+func (idx *dealIndex) ByPayload(payloadCid cid.Cid) (cid.Cid, bool, error) {
+	datum, err := idx.ds.Get(payloadIndexKey(payloadCid))
+	if err == datastore.ErrNotFound {
+		return cid.Undef, false, nil
+	}
+	if err != nil {
+		return cid.Undef, false, errors.Wrap(err, "failed to look up deal by payload cid")
+	}
+
+	proposalCid, err := cid.Decode(string(datum))
+	if err != nil {
+		return cid.Undef, false, errors.Wrap(err, "failed to decode indexed proposal cid")
+	}
+	return proposalCid, true, nil
+}
+
+// ByMiner returns every proposalCid of a deal this client has made with miner.
+func (idx *dealIndex) ByMiner(miner address.Address) ([]cid.Cid, error) {
+	datum, err := idx.ds.Get(minerIndexKey(miner))
+	if err == datastore.ErrNotFound {
+		return []cid.Cid{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up deals by miner")
+	}
+
+	var proposalCids []cid.Cid
+	if err := cbor.DecodeInto(datum, &proposalCids); err != nil {
+		return nil, errors.Wrap(err, "failed to decode indexed proposal cids")
+	}
+	return proposalCids, nil
+}
+
+func payloadIndexKey(payloadCid cid.Cid) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{payloadIndexPrefix, payloadCid.String()})
+}
+
+func minerIndexKey(miner address.Address) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{minerIndexPrefix, miner.String()})
+}
+
+// migrateDealIndex rebuilds the secondary indexes from every deal already on
+// disk. It is a no-op after the first time it runs against a given
+// datastore, so upgrading a node that already has the indexes does not pay
+// the cost of a full rescan on every boot.
+func migrateDealIndex(ds repo.Datastore, idx *dealIndex, deals map[cid.Cid]*deal.Deal) error {
+	migratedKey := datastore.NewKey(indexMigratedKey)
+	if _, err := ds.Get(migratedKey); err == nil {
+		return nil
+	} else if err != datastore.ErrNotFound {
+		return errors.Wrap(err, "failed to check deal index migration state")
+	}
+
+	for proposalCid, d := range deals {
+		if err := idx.Add(d.Proposal.PieceRef, d.Miner, proposalCid); err != nil {
+			return errors.Wrap(err, "failed to rebuild deal index")
+		}
+	}
+
+	return ds.Put(migratedKey, []byte("1"))
+}
+
+// DealsByMiner returns the client's deals made with miner.
+func (smc *Client) DealsByMiner(miner address.Address) ([]*deal.Deal, error) {
+	proposalCids, err := smc.dealIndex.ByMiner(miner)
+	if err != nil {
+		return nil, err
+	}
+
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	deals := make([]*deal.Deal, 0, len(proposalCids))
+	for _, proposalCid := range proposalCids {
+		if d, ok := smc.deals[proposalCid]; ok {
+			deals = append(deals, d)
+		}
+	}
+	return deals, nil
+}
+
+// DealByPayload returns the client's deal that moved payloadCid, if any.
+func (smc *Client) DealByPayload(payloadCid cid.Cid) (*deal.Deal, bool, error) {
+	proposalCid, ok, err := smc.dealIndex.ByPayload(payloadCid)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	smc.dealsLk.Lock()
+	defer smc.dealsLk.Unlock()
+	d, ok := smc.deals[proposalCid]
+	return d, ok, nil
+}
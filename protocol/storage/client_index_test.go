@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"testing"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/deal"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestDealIndexAddAndLookup(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	idx := newDealIndex(datastore.NewMapDatastore())
+	miner := address.Address{}
+	newCid := types.NewCidForTestGetter()
+	payloadCid := newCid()
+	proposalCid := newCid()
+
+	require.NoError(idx.Add(payloadCid, miner, proposalCid))
+
+	found, ok, err := idx.ByPayload(payloadCid)
+	require.NoError(err)
+	require.True(ok)
+	assert.Equal(proposalCid, found)
+
+	byMiner, err := idx.ByMiner(miner)
+	require.NoError(err)
+	assert.Equal([]cid.Cid{proposalCid}, byMiner)
+}
+
+func TestDealIndexByPayloadMissing(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	idx := newDealIndex(datastore.NewMapDatastore())
+
+	_, ok, err := idx.ByPayload(cid.Undef)
+	require.NoError(err)
+	assert.False(ok)
+}
+
+func TestDealIndexAddIsIdempotent(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	idx := newDealIndex(datastore.NewMapDatastore())
+	miner := address.Address{}
+	newCid := types.NewCidForTestGetter()
+	payloadCid := newCid()
+	proposalCid := newCid()
+
+	require.NoError(idx.Add(payloadCid, miner, proposalCid))
+	require.NoError(idx.Add(payloadCid, miner, proposalCid))
+
+	byMiner, err := idx.ByMiner(miner)
+	require.NoError(err)
+	assert.Len(byMiner, 1, "adding the same proposal twice should not duplicate the miner index entry")
+}
+
+func TestMigrateDealIndexBuildsIndexOnce(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	ds := datastore.NewMapDatastore()
+	idx := newDealIndex(ds)
+	miner := address.Address{}
+	newCid := types.NewCidForTestGetter()
+	proposalCid := newCid()
+	deals := map[cid.Cid]*deal.Deal{
+		proposalCid: {
+			Miner:    miner,
+			Proposal: &deal.Proposal{PieceRef: newCid()},
+			Response: &deal.Response{},
+		},
+	}
+
+	require.NoError(migrateDealIndex(ds, idx, deals))
+
+	byMiner, err := idx.ByMiner(miner)
+	require.NoError(err)
+	assert.Equal([]cid.Cid{proposalCid}, byMiner)
+
+	// A second migration against the same datastore must not rebuild the
+	// index from deals, since migrateDealIndex is meant to run once per node.
+	laterProposalCid := newCid()
+	laterDeals := map[cid.Cid]*deal.Deal{
+		laterProposalCid: {
+			Miner:    miner,
+			Proposal: &deal.Proposal{PieceRef: newCid()},
+			Response: &deal.Response{},
+		},
+	}
+	require.NoError(migrateDealIndex(ds, newDealIndex(ds), laterDeals))
+
+	byMiner, err = idx.ByMiner(miner)
+	require.NoError(err)
+	assert.Equal([]cid.Cid{proposalCid}, byMiner, "second migration should be a no-op")
+}
@@ -0,0 +1,165 @@
+// Package deal contains the wire and on-disk types shared by storage clients
+// and miners to describe a single storage deal and its lifecycle.
+package deal
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmRoARq3nkUb13HSKZGepCZSWe5GrVPwx7xURJGZ7KWv9V/go-ipld-cbor"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// ClientDatastorePrefix namespaces a client's deal records in its deals datastore.
+const ClientDatastorePrefix = "/storage/client/deals"
+
+// State describes where a deal is in its lifecycle, from the client's point of view.
+type State uint64
+
+const (
+	// Unknown is the zero value of State; it is never sent on the wire.
+	Unknown State = iota
+	// ProposalSent means the client has sent the proposal but has not yet heard back.
+	ProposalSent
+	// Accepted means the miner has accepted the deal proposal.
+	Accepted
+	// Rejected means the miner has rejected the deal proposal.
+	Rejected
+	// Failed means the deal failed, whether before or after being accepted.
+	Failed
+	// Staged means the miner has received the piece and staged it for sealing.
+	Staged
+	// Sealing means the miner is sealing the sector containing the piece.
+	Sealing
+	// Active means the deal's sector has been sealed and proven and the deal is live.
+	Active
+	// Complete means the deal's duration has elapsed and it is done.
+	Complete
+)
+
+func (s State) String() string {
+	switch s {
+	case Unknown:
+		return "unknown"
+	case ProposalSent:
+		return "proposal sent"
+	case Accepted:
+		return "accepted"
+	case Rejected:
+		return "rejected"
+	case Failed:
+		return "failed"
+	case Staged:
+		return "staged"
+	case Sealing:
+		return "sealing"
+	case Active:
+		return "active"
+	case Complete:
+		return "complete"
+	default:
+		return "unrecognized state"
+	}
+}
+
+// PaymentInfo holds the payment channel and vouchers backing a deal's price.
+type PaymentInfo struct {
+	Channel       *types.ChannelID
+	ChannelMsgCid string
+	Vouchers      []*paymentbroker.PaymentVoucher
+}
+
+// Proposal is the information sent by a client to propose a deal.
+type Proposal struct {
+	PieceRef     cid.Cid
+	Size         *types.BytesAmount
+	TotalPrice   *types.AttoFIL
+	Duration     uint64
+	MinerAddress address.Address
+	Payment      PaymentInfo
+
+	// LastDuplicate is set to the cid of the previous attempt when a proposal
+	// is re-cid'd to avoid colliding with an existing deal.
+	LastDuplicate string
+
+	// ProposerAddress is the wallet address that produced ProposerSignature;
+	// a miner verifies the signature against this address before accepting.
+	ProposerAddress address.Address
+	// ProposerSignature is the client's signature over the rest of this Proposal.
+	ProposerSignature []byte
+}
+
+// SigningBytes returns the deterministic payload that ProposerSignature signs
+// over: the CBOR encoding of the Proposal with ProposerSignature zeroed.
+func (p *Proposal) SigningBytes() ([]byte, error) {
+	cp := *p
+	cp.ProposerSignature = nil
+	return cbor.DumpObject(cp)
+}
+
+// Signer signs an arbitrary payload on behalf of a single wallet address. It
+// is satisfied by an adapter around the node's wallet.
+type Signer interface {
+	SignBytes(data []byte) ([]byte, error)
+}
+
+// Sign signs the proposal with signer and returns the resulting signature. It
+// does not set ProposerSignature itself; callers attach the result once they
+// have it.
+func (p *Proposal) Sign(signer Signer) ([]byte, error) {
+	digest, err := p.SigningBytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build proposal signing payload")
+	}
+	return signer.SignBytes(digest)
+}
+
+// Verifier checks a signature produced by a Signer. It is satisfied by an
+// adapter around the miner's wallet.
+type Verifier interface {
+	VerifyBytes(data []byte, sig []byte, addr address.Address) (bool, error)
+}
+
+// Verify checks that ProposerSignature is a valid signature by from over the
+// rest of the Proposal. A miner must call this, and reject the proposal if it
+// errors, before accepting it.
+func (p *Proposal) Verify(verifier Verifier, from address.Address) error {
+	if len(p.ProposerSignature) == 0 {
+		return errors.New("proposal is not signed")
+	}
+
+	digest, err := p.SigningBytes()
+	if err != nil {
+		return errors.Wrap(err, "failed to build proposal signing payload")
+	}
+
+	ok, err := verifier.VerifyBytes(digest, p.ProposerSignature, from)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify proposal signature")
+	}
+	if !ok {
+		return errors.New("proposal signature is invalid")
+	}
+	return nil
+}
+
+// Response is returned by a miner in reply to a Proposal or QueryRequest.
+type Response struct {
+	State       State
+	Message     string
+	ProposalCid cid.Cid
+}
+
+// QueryRequest is sent by a client to ask a miner for the current State of a deal.
+type QueryRequest struct {
+	Cid cid.Cid
+}
+
+// Deal is the client's local record of a single storage deal.
+type Deal struct {
+	Miner    address.Address
+	Proposal *Proposal
+	Response *Response
+}
@@ -0,0 +1,93 @@
+package deal
+
+import (
+	"testing"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+// fakeSigner signs by returning the digest itself, so a fakeVerifier can
+// check it back without any real cryptography.
+type fakeSigner struct{}
+
+func (fakeSigner) SignBytes(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) VerifyBytes(data []byte, sig []byte, addr address.Address) (bool, error) {
+	if len(data) != len(sig) {
+		return false, nil
+	}
+	for i := range data {
+		if data[i] != sig[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+type erroringVerifier struct{}
+
+func (erroringVerifier) VerifyBytes(data []byte, sig []byte, addr address.Address) (bool, error) {
+	return false, errors.New("verifier is unavailable")
+}
+
+func newTestProposal() *Proposal {
+	return &Proposal{
+		PieceRef:     cid.Undef,
+		Duration:     10,
+		MinerAddress: address.Address{},
+	}
+}
+
+func TestProposalSignAndVerifyRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	p := newTestProposal()
+	sig, err := p.Sign(fakeSigner{})
+	require.NoError(err)
+	p.ProposerSignature = sig
+
+	require.NoError(p.Verify(fakeVerifier{}, address.Address{}))
+}
+
+func TestProposalVerifyRejectsUnsigned(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProposal()
+	assert.Error(p.Verify(fakeVerifier{}, address.Address{}))
+}
+
+func TestProposalVerifyRejectsTamperedProposal(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProposal()
+	sig, err := p.Sign(fakeSigner{})
+	assert.NoError(err)
+	p.ProposerSignature = sig
+
+	// Mutate the proposal after signing: the signature no longer covers
+	// Duration's new value, so verification must fail.
+	p.Duration = 99
+
+	assert.Error(p.Verify(fakeVerifier{}, address.Address{}))
+}
+
+func TestProposalVerifyPropagatesVerifierError(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProposal()
+	sig, err := p.Sign(fakeSigner{})
+	assert.NoError(err)
+	p.ProposerSignature = sig
+
+	assert.Error(p.Verify(erroringVerifier{}, address.Address{}))
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+// eventRingSize bounds how many recent events an eventBus retains for
+// introspection, independent of how many subscribers are listening.
+const eventRingSize = 256
+
+// subscriberBuffer bounds how many unconsumed events a single subscriber
+// channel holds before Publish starts dropping events for it, so a slow
+// subscriber cannot block the deals manager.
+const subscriberBuffer = 32
+
+// EventType identifies the kind of deal lifecycle Event that occurred.
+type EventType uint64
+
+const (
+	// DealProposed is the type of an update to a state with no more specific
+	// type (Unknown or ProposalSent). The Client records a deal only once the
+	// miner has accepted it, so sending a proposal publishes no DealProposed.
+	DealProposed EventType = iota
+	// DealAccepted is emitted once a miner accepts a proposal.
+	DealAccepted
+	// DealRejected is emitted once a miner rejects a proposal.
+	DealRejected
+	// DealFailed is emitted when a deal fails after being accepted.
+	DealFailed
+	// DealStaged is emitted once the miner has received the piece and staged
+	// it for sealing.
+	DealStaged
+	// DealSealing is emitted once the miner starts sealing the sector
+	// containing the piece.
+	DealSealing
+	// DealActive is emitted once a deal's sector is sealed and the deal is live.
+	DealActive
+	// DealCompleted is emitted once a deal's duration has elapsed.
+	DealCompleted
+	// VoucherRedeemed denotes the miner redeeming a payment voucher; no code
+	// in this package publishes it.
+	VoucherRedeemed
+)
+
+// Event describes a single change in a deal's lifecycle.
+type Event struct {
+	Type        EventType
+	ProposalCid cid.Cid
+	Miner       address.Address
+	Timestamp   int64
+	Payload     interface{}
+}
+
+// Filter decides whether a subscriber is interested in an Event.
+type Filter func(Event) bool
+
+// CancelFunc unregisters a subscription created by Subscribe.
+type CancelFunc func()
+
+// eventBus fans typed deal events out to filtered subscribers. It keeps a
+// bounded ring buffer of the most recent events so that a burst of activity
+// has a fixed memory cost regardless of how many, or how few, subscribers are
+// listening.
+type eventBus struct {
+	mu   sync.Mutex
+	ring []Event
+	head int
+
+	subs map[chan Event]Filter
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		ring: make([]Event, 0, eventRingSize),
+		subs: make(map[chan Event]Filter),
+	}
+}
+
+// Publish records ev in the ring buffer and delivers it to every subscriber
+// whose Filter accepts it. Delivery is non-blocking: a subscriber that isn't
+// keeping up has events dropped rather than stalling the caller.
+func (b *eventBus) Publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.ring) < cap(b.ring) {
+		b.ring = append(b.ring, ev)
+	} else {
+		b.ring[b.head] = ev
+		b.head = (b.head + 1) % cap(b.ring)
+	}
+
+	for ch, filter := range b.subs {
+		if filter != nil && !filter(ev) {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+			log.Warningf("dropping deal event for slow subscriber, proposalCid: %s", ev.ProposalCid)
+		}
+	}
+}
+
+// Recent returns up to eventRingSize of the most recently published events,
+// oldest first. It lets a late subscriber (or a status command) see what it
+// missed instead of only ever seeing events published after it connects.
+func (b *eventBus) Recent() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.ring) < cap(b.ring) {
+		out := make([]Event, len(b.ring))
+		copy(out, b.ring)
+		return out
+	}
+
+	out := make([]Event, 0, len(b.ring))
+	out = append(out, b.ring[b.head:]...)
+	out = append(out, b.ring[:b.head]...)
+	return out
+}
+
+// Subscribe registers a channel that receives every future Event matching
+// filter. A nil filter matches every Event. The returned CancelFunc must be
+// called to unregister the channel and release its resources.
+func (b *eventBus) Subscribe(filter Filter) (<-chan Event, CancelFunc) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = filter
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+		close(ch)
+	}
+	return ch, cancel
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"testing"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBusFiltersSubscribers(t *testing.T) {
+	require := require.New(t)
+
+	b := newEventBus()
+	proposalCid := cid.Undef
+
+	matching, cancelMatching := b.Subscribe(func(ev Event) bool { return ev.Type == DealAccepted })
+	defer cancelMatching()
+	nonMatching, cancelNonMatching := b.Subscribe(func(ev Event) bool { return ev.Type == DealRejected })
+	defer cancelNonMatching()
+
+	b.Publish(Event{Type: DealAccepted, ProposalCid: proposalCid})
+
+	select {
+	case ev := <-matching:
+		require.Equal(DealAccepted, ev.Type)
+	default:
+		t.Fatal("matching subscriber should have received the event")
+	}
+
+	select {
+	case <-nonMatching:
+		t.Fatal("non-matching subscriber should not have received the event")
+	default:
+	}
+}
+
+func TestEventBusCancelStopsDelivery(t *testing.T) {
+	assert := assert.New(t)
+
+	b := newEventBus()
+	ch, cancel := b.Subscribe(nil)
+	cancel()
+
+	b.Publish(Event{Type: DealAccepted})
+
+	_, ok := <-ch
+	assert.False(ok, "channel should be closed after cancel")
+}
+
+func TestEventBusRecentIsBoundedAndOrdered(t *testing.T) {
+	assert := assert.New(t)
+
+	b := newEventBus()
+	for i := 0; i < eventRingSize+10; i++ {
+		b.Publish(Event{Type: DealAccepted, Timestamp: int64(i)})
+	}
+
+	recent := b.Recent()
+	require.Len(t, recent, eventRingSize)
+	assert.EqualValues(10, recent[0].Timestamp, "oldest surviving event should be the 11th published")
+	assert.EqualValues(eventRingSize+9, recent[len(recent)-1].Timestamp, "newest event should be last")
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+
+	net "gx/ipfs/QmQSbtGXCyNrj34LWL8EgXyNNYDZ8r3SwQcpW5pPxVhLnM/go-libp2p-net"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/protocol/storage/deal"
+)
+
+// minerPorcelainAPI is the subset of node functionality a Miner needs to
+// verify an incoming deal proposal's signature.
+type minerPorcelainAPI interface {
+	WalletVerify(addr address.Address, data []byte, sig []byte) (bool, error)
+}
+
+// walletVerifier adapts minerPorcelainAPI.WalletVerify to deal.Verifier.
+type walletVerifier struct {
+	api minerPorcelainAPI
+}
+
+func (w walletVerifier) VerifyBytes(data []byte, sig []byte, addr address.Address) (bool, error) {
+	return w.api.WalletVerify(addr, data, sig)
+}
+
+// Miner is the miner side of the storage deal protocol.
+type Miner struct {
+	api minerPorcelainAPI
+}
+
+// NewMiner returns a Miner that verifies incoming proposals against api.
+func NewMiner(api minerPorcelainAPI) *Miner {
+	return &Miner{api: api}
+}
+
+// HandleMakeDeal is the makeDealProtocol stream handler. It rejects any
+// proposal whose ProposerSignature does not verify against ProposerAddress
+// before accepting it.
+func (sm *Miner) HandleMakeDeal(s net.Stream) error {
+	var proposal deal.Proposal
+	if err := cbu.NewMsgReader(s).ReadMsg(&proposal); err != nil {
+		return errors.Wrap(err, "failed to read proposal")
+	}
+
+	resp := deal.Response{}
+	if err := proposal.Verify(walletVerifier{api: sm.api}, proposal.ProposerAddress); err != nil {
+		resp.State = deal.Rejected
+		resp.Message = fmt.Sprintf("invalid proposal signature: %s", err)
+	} else {
+		resp.State = deal.Accepted
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(resp); err != nil {
+		return errors.Wrap(err, "failed to write deal response")
+	}
+	return nil
+}